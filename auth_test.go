@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign test token: %v", err)
+	}
+	return signed
+}
+
+func TestJwksCacheVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	const kid = "test-key"
+	cache := &jwksCache{keys: map[string]*rsa.PublicKey{kid: &key.PublicKey}}
+
+	validClaims := jwt.MapClaims{
+		"iss": "https://issuer.example",
+		"aud": "https://audience.example",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		issuer   string
+		audience string
+		wantErr  bool
+	}{
+		{
+			name:  "valid token with no issuer/audience requirement",
+			token: signRS256(t, key, kid, validClaims),
+		},
+		{
+			name:     "valid token matching issuer and audience",
+			token:    signRS256(t, key, kid, validClaims),
+			issuer:   "https://issuer.example",
+			audience: "https://audience.example",
+		},
+		{
+			name:    "issuer mismatch",
+			token:   signRS256(t, key, kid, validClaims),
+			issuer:  "https://other-issuer.example",
+			wantErr: true,
+		},
+		{
+			name:     "audience mismatch",
+			token:    signRS256(t, key, kid, validClaims),
+			audience: "https://other-audience.example",
+			wantErr:  true,
+		},
+		{
+			name:    "unknown kid",
+			token:   signRS256(t, key, "no-such-key", validClaims),
+			wantErr: true,
+		},
+		{
+			name:    "expired token",
+			token:   signRS256(t, key, kid, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}),
+			wantErr: true,
+		},
+		{
+			name: "HS256-signed token is rejected regardless of key lookup",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims)
+				token.Header["kid"] = kid
+				signed, err := token.SignedString([]byte("attacker-controlled-secret"))
+				if err != nil {
+					t.Fatalf("failed to sign HS256 test token: %v", err)
+				}
+				return signed
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := cache.Verify(tc.token, tc.issuer, tc.audience)
+			if tc.wantErr && err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpcwebproxy_http_request_duration_seconds",
+		Help:    "Latency of grpc-web HTTP requests, labeled by service, method, and grpc-status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method", "code"})
+
+	httpResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpcwebproxy_http_response_size_bytes",
+		Help:    "Size of grpc-web HTTP responses, labeled by service, method, and grpc-status code.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 10),
+	}, []string{"service", "method", "code"})
+)
+
+// NewAccessLogMiddleware wraps next (typically the grpcweb.WrappedGrpcServer)
+// with per-route Prometheus histograms and a structured zap access log
+// entry, since grpczap/grpcprom only instrument the inner grpc.Server and
+// know nothing about the outer HTTP grpc-web layer.
+//
+// The grpc-status of the RPC can't be read off the outer ResponseWriter:
+// grpc-web frames grpc-status/grpc-message in-band in the response body
+// (browsers can't read real HTTP trailers), never as a header or trailer on
+// this writer. Instead, a grpcStatusRecorder is stashed in the request
+// context before calling next, and grpcStatusUnaryInterceptor/
+// grpcStatusStreamInterceptor (run inside the wrapped grpc.Server) fill it
+// in with the RPC's final status before returning.
+func NewAccessLogMiddleware(logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mw := &metricsResponseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		recorder := &grpcStatusRecorder{}
+		r = r.WithContext(context.WithValue(r.Context(), grpcStatusKey{}, recorder))
+
+		next.ServeHTTP(mw, r)
+
+		duration := time.Since(start)
+		service, method := parseServiceMethod(r.URL.Path)
+		grpcStatus := recorder.String()
+
+		httpRequestDuration.WithLabelValues(service, method, grpcStatus).Observe(duration.Seconds())
+		httpResponseSize.WithLabelValues(service, method, grpcStatus).Observe(float64(mw.bytes))
+
+		logger.Info("grpc-web access",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("service", service),
+			zap.String("rpc", method),
+			zap.Int("http_status", mw.status),
+			zap.String("grpc_status", grpcStatus),
+			zap.String("origin", r.Header.Get("Origin")),
+			zap.String("user_agent", r.Header.Get("User-Agent")),
+			zap.Duration("duration", duration),
+		)
+	})
+}
+
+// metricsResponseWriter records the HTTP status code and bytes written, so
+// the wrapping middleware can observe them once the handler is done.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *metricsResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *metricsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// grpcStatusKey is the context key under which grpcStatusRecorder is
+// stashed between NewAccessLogMiddleware and the grpc interceptor chain
+// that actually learns the RPC's outcome, mirroring how authClaimsKey
+// threads AuthClaims the other way.
+type grpcStatusKey struct{}
+
+// grpcStatusRecorder is a mutable out-parameter carried through the request
+// context: NewAccessLogMiddleware creates one and reads it after the
+// handler returns, while grpcStatusUnaryInterceptor/
+// grpcStatusStreamInterceptor write the RPC's final status into it from
+// inside the grpc.Server.
+type grpcStatusRecorder struct {
+	mu   sync.Mutex
+	code codes.Code
+	set  bool
+}
+
+func (r *grpcStatusRecorder) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.code = status.Code(err)
+	r.set = true
+}
+
+// String returns the recorded grpc-status code's name, or "unknown" if
+// nothing was ever recorded (e.g. the request never reached a grpc
+// interceptor, such as a malformed grpc-web frame).
+func (r *grpcStatusRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.set {
+		return "unknown"
+	}
+	return r.code.String()
+}
+
+// grpcStatusUnaryInterceptor records the final status of each unary RPC
+// into the grpcStatusRecorder stashed in ctx by NewAccessLogMiddleware, if
+// one is present. It's a no-op otherwise, so the grpc.Server can still be
+// used without the HTTP access-log wrapper.
+func grpcStatusUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if recorder, ok := ctx.Value(grpcStatusKey{}).(*grpcStatusRecorder); ok {
+		recorder.record(err)
+	}
+	return resp, err
+}
+
+// grpcStatusStreamInterceptor is grpcStatusUnaryInterceptor's streaming
+// counterpart.
+func grpcStatusStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	if recorder, ok := ss.Context().Value(grpcStatusKey{}).(*grpcStatusRecorder); ok {
+		recorder.record(err)
+	}
+	return err
+}
+
+// maxTrackedServiceMethods bounds how many distinct "service/method" label
+// pairs parseServiceMethod will mint before collapsing the rest into a
+// single "overflow" bucket. Without this, a client hitting arbitrary
+// /whatever1/whatever2 paths could explode the Prometheus label
+// cardinality for httpRequestDuration/httpResponseSize.
+const maxTrackedServiceMethods = 1000
+
+// defaultServiceMethodLabeler is the process-wide cardinality guard used by
+// parseServiceMethod.
+var defaultServiceMethodLabeler = newServiceMethodLabeler(maxTrackedServiceMethods)
+
+// serviceMethodLabeler remembers every distinct "service/method" pair it has
+// minted, up to max, and collapses anything beyond that into "overflow" so
+// the caller has a hard ceiling on label cardinality.
+type serviceMethodLabeler struct {
+	max int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newServiceMethodLabeler(max int) *serviceMethodLabeler {
+	return &serviceMethodLabeler{max: max, seen: make(map[string]struct{})}
+}
+
+// parseServiceMethod extracts the "package.Service" and "Method" labels
+// from a grpc-web request path of the form "/package.Service/Method".
+func parseServiceMethod(path string) (service, method string) {
+	return defaultServiceMethodLabeler.label(path)
+}
+
+func (l *serviceMethodLabeler) label(path string) (service, method string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "unknown", "unknown"
+	}
+	service, method = parts[0], parts[1]
+
+	key := service + "/" + method
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[key]; !ok {
+		if len(l.seen) >= l.max {
+			return "overflow", "overflow"
+		}
+		l.seen[key] = struct{}{}
+	}
+	return service, method
+}
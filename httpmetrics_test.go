@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseServiceMethod(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		wantService string
+		wantMethod  string
+	}{
+		{
+			name:        "well-formed grpc-web path",
+			path:        "/pkg.Service/Method",
+			wantService: "pkg.Service",
+			wantMethod:  "Method",
+		},
+		{
+			name:        "missing method segment",
+			path:        "/pkg.Service",
+			wantService: "unknown",
+			wantMethod:  "unknown",
+		},
+		{
+			name:        "empty path",
+			path:        "/",
+			wantService: "unknown",
+			wantMethod:  "unknown",
+		},
+		{
+			name:        "extra path segments fold into the method label",
+			path:        "/pkg.Service/Method/extra",
+			wantService: "pkg.Service",
+			wantMethod:  "Method/extra",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			labeler := newServiceMethodLabeler(maxTrackedServiceMethods)
+			service, method := labeler.label(tc.path)
+			if service != tc.wantService || method != tc.wantMethod {
+				t.Errorf("label(%q) = (%q, %q), want (%q, %q)", tc.path, service, method, tc.wantService, tc.wantMethod)
+			}
+		})
+	}
+}
+
+func TestServiceMethodLabelerBoundsCardinality(t *testing.T) {
+	labeler := newServiceMethodLabeler(2)
+
+	service, method := labeler.label("/a.A/One")
+	if service != "a.A" || method != "One" {
+		t.Fatalf("first distinct pair should be labeled as-is, got (%q, %q)", service, method)
+	}
+	service, method = labeler.label("/b.B/Two")
+	if service != "b.B" || method != "Two" {
+		t.Fatalf("second distinct pair should be labeled as-is, got (%q, %q)", service, method)
+	}
+
+	// A third distinct pair exceeds max and must collapse to the bounded bucket.
+	service, method = labeler.label("/c.C/Three")
+	if service != "overflow" || method != "overflow" {
+		t.Errorf("pair beyond max should collapse to overflow, got (%q, %q)", service, method)
+	}
+
+	// Re-requesting an already-tracked pair still gets its real label.
+	service, method = labeler.label("/a.A/One")
+	if service != "a.A" || method != "One" {
+		t.Errorf("already-tracked pair should keep its label after overflow, got (%q, %q)", service, method)
+	}
+}
+
+func TestGRPCStatusRecorder(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "never recorded",
+			want: "unknown",
+		},
+		{
+			name: "nil error records OK",
+			err:  nil,
+			want: codes.OK.String(),
+		},
+		{
+			name: "status error records its code",
+			err:  status.Error(codes.Unavailable, "no healthy upstream endpoints"),
+			want: codes.Unavailable.String(),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &grpcStatusRecorder{}
+			if tc.name != "never recorded" {
+				recorder.record(tc.err)
+			}
+			if got := recorder.String(); got != tc.want {
+				t.Errorf("String() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestNewAccessLogMiddlewareRecordsGRPCStatus exercises the full path a
+// real grpc-web request takes: grpc-web never sets grpc-status as a header
+// on the outer ResponseWriter, so the only way the middleware can learn the
+// RPC's outcome is by reading the grpcStatusRecorder that a downstream grpc
+// interceptor (standing in for grpcStatusUnaryInterceptor here) fills in
+// via the request context.
+func TestNewAccessLogMiddlewareRecordsGRPCStatus(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder, ok := r.Context().Value(grpcStatusKey{}).(*grpcStatusRecorder)
+		if !ok {
+			t.Fatalf("grpcStatusRecorder missing from request context")
+		}
+		recorder.record(status.Error(codes.PermissionDenied, "missing required scope"))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var gotRecorder *grpcStatusRecorder
+	handler := NewAccessLogMiddleware(zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRecorder, _ = r.Context().Value(grpcStatusKey{}).(*grpcStatusRecorder)
+		next.ServeHTTP(w, r)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if gotRecorder == nil {
+		t.Fatalf("NewAccessLogMiddleware did not stash a grpcStatusRecorder in the context")
+	}
+	if got := gotRecorder.String(); got != codes.PermissionDenied.String() {
+		t.Errorf("recorded grpc-status = %q, want %q", got, codes.PermissionDenied.String())
+	}
+}
+
+func TestGRPCStatusUnaryInterceptorRecordsFinalStatus(t *testing.T) {
+	recorder := &grpcStatusRecorder{}
+	ctx := context.WithValue(context.Background(), grpcStatusKey{}, recorder)
+
+	wantErr := status.Error(codes.Unauthenticated, "invalid token")
+	_, err := grpcStatusUnaryInterceptor(ctx, nil, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("interceptor returned %v, want %v", err, wantErr)
+	}
+	if got := recorder.String(); got != codes.Unauthenticated.String() {
+		t.Errorf("recorded grpc-status = %q, want %q", got, codes.Unauthenticated.String())
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	grpcmw "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpczap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
@@ -13,13 +15,11 @@ import (
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"github.com/jzelinskie/stringz"
 	"github.com/mwitkow/grpc-proxy/proxy"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -49,14 +49,29 @@ func syncViper(cmd *cobra.Command, prefix string) error {
 }
 
 func main() {
-	rootCmd.Flags().String("upstream-addr", "127.0.0.1:50051", "address of the upstream gRPC service")
-	rootCmd.Flags().String("upstream-cert-path", "", "local path to the TLS certificate of the upstream gRPC service")
+	rootCmd.Flags().String("upstream-addr", "127.0.0.1:50051", "comma-separated addresses of the upstream gRPC service; RPCs are round-robined across whichever are healthy")
+	rootCmd.Flags().String("upstream-ca", "", "local path to a PEM CA bundle used to verify the upstream gRPC service's certificate")
+	rootCmd.Flags().String("upstream-cert", "", "local path to a client TLS certificate for mutual TLS to the upstream gRPC service")
+	rootCmd.Flags().String("upstream-key", "", "local path to the client TLS key matching upstream-cert")
+	rootCmd.Flags().String("upstream-server-name", "", "override the server name used to verify the upstream's certificate")
 	rootCmd.Flags().String("web-addr", ":80", "address to listen on for grpc-web requests")
 	rootCmd.Flags().String("web-key-path", "", "local path to the TLS key of the grpc-web server")
 	rootCmd.Flags().String("web-cert-path", "", "local path to the TLS certificate of the grpc-web server")
+	rootCmd.Flags().String("web-client-ca", "", "local path to a PEM CA bundle used to verify client certificates from browsers/clients (enables mTLS)")
+	rootCmd.Flags().Bool("web-require-client-cert", false, "require and verify a client certificate from browsers/clients against web-client-ca")
 	rootCmd.Flags().String("web-allowed-origins", "", "CORS allowed origins for grpc-web (comma-separated)")
 	rootCmd.Flags().String("metrics-addr", ":9090", "address to listen on for the metrics server")
 	rootCmd.Flags().Bool("debug", false, "debug log verbosity")
+	rootCmd.Flags().String("listen-addr", "", "if set, multiplex grpc-web, native grpc, metrics, and debug endpoints on this single address instead of web-addr/metrics-addr")
+	rootCmd.Flags().Bool("serve-native-grpc", false, "on the multiplexed listen-addr, also accept native (non-web) grpc clients alongside grpc-web")
+	rootCmd.Flags().Bool("enable-pprof", false, "expose net/http/pprof debug handlers on the metrics interface")
+	rootCmd.Flags().String("auth-jwks-url", "", "if set, require a valid `Authorization: Bearer` JWT signed by a key from this JWKS URL")
+	rootCmd.Flags().String("auth-issuer", "", "required `iss` claim on incoming JWTs (ignored if empty)")
+	rootCmd.Flags().String("auth-audience", "", "required `aud` claim on incoming JWTs (ignored if empty)")
+	rootCmd.Flags().String("auth-required-scopes", "", "comma-separated scopes that must all be present on incoming JWTs")
+	rootCmd.Flags().String("forward-headers", "", "comma-separated allow-list of browser headers to forward to the backend (default: forward all except strip-headers)")
+	rootCmd.Flags().String("strip-headers", "user-agent,connection", "comma-separated deny-list of browser headers to drop before forwarding to the backend (ignored if forward-headers is set)")
+	rootCmd.Flags().Duration("shutdown-timeout", 20*time.Second, "how long to wait for in-flight requests to drain on SIGINT/SIGTERM before forcing an exit")
 
 	rootCmd.Execute()
 }
@@ -68,12 +83,35 @@ func rootRun(cmd *cobra.Command, args []string) {
 	}
 	defer logger.Sync()
 
-	upstream, err := NewUpstreamConnection(MustGetString(cmd, "upstream-addr"), MustGetString(cmd, "upstream-cert-path"))
+	upstreamTLSConfig, err := NewUpstreamTLSConfig(
+		MustGetString(cmd, "upstream-ca"),
+		MustGetString(cmd, "upstream-cert"),
+		MustGetString(cmd, "upstream-key"),
+		MustGetString(cmd, "upstream-server-name"),
+	)
+	if err != nil {
+		logger.Fatal("failed to build upstream TLS config", zap.String("error", err.Error()))
+	}
+
+	upstreamAddrs := strings.Split(MustGetString(cmd, "upstream-addr"), ",")
+	upstream, err := NewUpstreamPool(logger, upstreamAddrs, upstreamTLSConfig)
 	if err != nil {
 		logger.Fatal("failed to connect to upstream", zap.String("error", err.Error()))
 	}
 
-	srv, err := NewGrpcProxyServer(logger, upstream)
+	var auth *jwtAuthenticator
+	if jwksURL := MustGetString(cmd, "auth-jwks-url"); jwksURL != "" {
+		requiredScopes := splitAndTrim(MustGetString(cmd, "auth-required-scopes"))
+		auth, err = NewJWTAuthenticator(logger, jwksURL, MustGetString(cmd, "auth-issuer"), MustGetString(cmd, "auth-audience"), requiredScopes)
+		if err != nil {
+			logger.Fatal("failed to init JWT authenticator", zap.String("error", err.Error()))
+		}
+	}
+
+	forwardHeaders := splitAndTrim(MustGetString(cmd, "forward-headers"))
+	stripHeaders := splitAndTrim(MustGetString(cmd, "strip-headers"))
+
+	srv, err := NewGrpcProxyServer(logger, upstream, auth, forwardHeaders, stripHeaders)
 	if err != nil {
 		logger.Fatal("failed to init grpc server", zap.String("error", err.Error()))
 	}
@@ -83,35 +121,23 @@ func rootRun(cmd *cobra.Command, args []string) {
 	if err != nil {
 		logger.Fatal("failed to init grpcweb server", zap.String("error", err.Error()))
 	}
+	webHandler := NewAccessLogMiddleware(logger, grpcwebsrv)
 
-	go func() {
-		certPath := MustGetString(cmd, "web-cert-path")
-		keyPath := MustGetString(cmd, "web-key-path")
-		websrv := &http.Server{
-			Addr:    MustGetString(cmd, "web-addr"),
-			Handler: grpcwebsrv,
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		if certPath != "" && keyPath != "" {
-			logger.Info(
-				"grpc-web server listening over HTTPS",
-				zap.String("addr", MustGetString(cmd, "web-addr")),
-				zap.String("certPath", certPath),
-				zap.String("keyPath", keyPath),
-			)
-			websrv.ListenAndServeTLS(certPath, keyPath)
-		} else {
-			logger.Info(
-				"grpc-web server listening over HTTP",
-				zap.String("addr", MustGetString(cmd, "web-addr")),
-			)
-			websrv.ListenAndServe()
+	shutdownTimeout := MustGetDuration(cmd, "shutdown-timeout")
+
+	if listenAddr := MustGetString(cmd, "listen-addr"); listenAddr != "" {
+		if err := runMultiplexed(ctx, cmd, logger, srv, webHandler, upstream, listenAddr, shutdownTimeout); err != nil {
+			logger.Fatal("multiplexed server exited with error", zap.String("error", err.Error()))
 		}
-	}()
+		return
+	}
 
-	logger.Info("metrics server listening over HTTP", zap.String("addr", MustGetString(cmd, "metrics-addr")))
-	http.Handle("/metrics", promhttp.Handler())
-	http.ListenAndServe(MustGetString(cmd, "metrics-addr"), nil)
+	if err := runLegacy(ctx, cmd, logger, srv, webHandler, upstream, shutdownTimeout); err != nil {
+		logger.Fatal("server exited with error", zap.String("error", err.Error()))
+	}
 }
 
 func NewGrpcWebServer(srv *grpc.Server, allowedOrigins []string) (*grpcweb.WrappedGrpcServer, error) {
@@ -121,49 +147,77 @@ func NewGrpcWebServer(srv *grpc.Server, allowedOrigins []string) (*grpcweb.Wrapp
 	), nil
 }
 
-func NewGrpcProxyServer(logger *zap.Logger, upstream *grpc.ClientConn) (*grpc.Server, error) {
+func NewGrpcProxyServer(logger *zap.Logger, upstream *upstreamPool, auth *jwtAuthenticator, forwardHeaders, stripHeaders []string) (*grpc.Server, error) {
 	grpc.EnableTracing = true
 	grpczap.ReplaceGrpcLogger(logger)
+	grpcprom.EnableHandlingTimeHistogram()
 
 	// If the connection header is present in the request from the web client,
 	// the actual connection to the backend will not be established.
 	// https://github.com/improbable-eng/grpc-web/issues/568
 	director := func(ctx context.Context, _ string) (context.Context, *grpc.ClientConn, error) {
+		conn, err := upstream.PickConn()
+		if err != nil {
+			return ctx, nil, err
+		}
+
 		metadataIn, _ := metadata.FromIncomingContext(ctx)
-		md := metadataIn.Copy()
-		delete(md, "user-agent")
-		delete(md, "connection")
-		return metadata.NewOutgoingContext(ctx, md), upstream, nil
+		md := filterMetadata(metadataIn, forwardHeaders, stripHeaders)
+
+		if claims, ok := AuthClaimsFromContext(ctx); ok {
+			md.Set("x-auth-subject", claims.Subject)
+			md.Set("x-auth-scopes", strings.Join(claims.Scopes, " "))
+		}
+
+		return metadata.NewOutgoingContext(ctx, md), conn, nil
+	}
+
+	// grpcStatusUnaryInterceptor/grpcStatusStreamInterceptor go first so they
+	// wrap every other interceptor (including auth) and observe the RPC's
+	// truly final status before it's reported to NewAccessLogMiddleware.
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		grpcStatusUnaryInterceptor,
+		grpczap.UnaryServerInterceptor(logger),
+		grpcprom.UnaryServerInterceptor,
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		grpcStatusStreamInterceptor,
+		grpczap.StreamServerInterceptor(logger),
+		grpcprom.StreamServerInterceptor,
+	}
+	if auth != nil {
+		unaryInterceptors = append(unaryInterceptors, auth.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, auth.StreamServerInterceptor())
 	}
 
 	return grpc.NewServer(
 		grpc.CustomCodec(proxy.Codec()),
 		grpc.UnknownServiceHandler(proxy.TransparentHandler(director)),
-		grpcmw.WithUnaryServerChain(
-			grpczap.UnaryServerInterceptor(logger),
-			grpcprom.UnaryServerInterceptor,
-		),
-		grpcmw.WithStreamServerChain(
-			grpczap.StreamServerInterceptor(logger),
-			grpcprom.StreamServerInterceptor,
-		),
+		grpcmw.WithUnaryServerChain(unaryInterceptors...),
+		grpcmw.WithStreamServerChain(streamInterceptors...),
 	), nil
 }
 
-func NewUpstreamConnection(addr string, certPath string) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
-	if certPath != "" {
-		creds, err := credentials.NewClientTLSFromFile(certPath, "")
-		if err != nil {
-			return nil, err
+// filterMetadata decides which incoming browser headers propagate to the
+// backend. If forwardHeaders is non-empty it's an allow-list of the only
+// headers kept; otherwise stripHeaders is a deny-list of headers dropped
+// from an otherwise-forwarded set.
+func filterMetadata(md metadata.MD, forwardHeaders, stripHeaders []string) metadata.MD {
+	if len(forwardHeaders) > 0 {
+		filtered := metadata.MD{}
+		for _, key := range forwardHeaders {
+			if values := md.Get(key); len(values) > 0 {
+				filtered.Set(key, values...)
+			}
 		}
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-	} else {
-		opts = append(opts, grpc.WithInsecure())
+		return filtered
 	}
 
-	opts = append(opts, grpc.WithCodec(proxy.Codec()))
-	return grpc.Dial(addr, opts...)
+	filtered := md.Copy()
+	for _, key := range stripHeaders {
+		delete(filtered, strings.ToLower(key))
+	}
+	return filtered
 }
 
 func NewAllowedOriginsFunc(urls []string) func(string) bool {
@@ -186,6 +240,14 @@ func MustGetBool(cmd *cobra.Command, key string) bool {
 	return val
 }
 
+func MustGetDuration(cmd *cobra.Command, key string) time.Duration {
+	val, err := cmd.Flags().GetDuration(key)
+	if err != nil {
+		panic(fmt.Sprintf("failed to find flag %s: %s", key, err))
+	}
+	return val
+}
+
 func MustGetString(cmd *cobra.Command, key string) string {
 	val, err := cmd.Flags().GetString(key)
 	if err != nil {
@@ -193,3 +255,19 @@ func MustGetString(cmd *cobra.Command, key string) string {
 	}
 	return os.ExpandEnv(val)
 }
+
+// splitAndTrim splits a comma-separated flag value into its trimmed,
+// non-empty parts, returning nil for an empty input.
+func splitAndTrim(csv string) []string {
+	if csv == "" {
+		return nil
+	}
+
+	var out []string
+	for _, part := range strings.Split(csv, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
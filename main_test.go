@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestFilterMetadata(t *testing.T) {
+	md := metadata.MD{
+		"authorization": []string{"Bearer abc"},
+		"user-agent":    []string{"grpc-web-js/1.0"},
+		"connection":    []string{"keep-alive"},
+		"x-request-id":  []string{"req-1"},
+	}
+
+	cases := []struct {
+		name           string
+		forwardHeaders []string
+		stripHeaders   []string
+		want           metadata.MD
+	}{
+		{
+			name:           "allow-list keeps only the named headers",
+			forwardHeaders: []string{"authorization"},
+			want:           metadata.MD{"authorization": []string{"Bearer abc"}},
+		},
+		{
+			name:         "deny-list drops the named headers and keeps the rest",
+			stripHeaders: []string{"user-agent", "connection"},
+			want: metadata.MD{
+				"authorization": []string{"Bearer abc"},
+				"x-request-id":  []string{"req-1"},
+			},
+		},
+		{
+			name: "no allow-list or deny-list forwards everything",
+			want: metadata.MD{
+				"authorization": []string{"Bearer abc"},
+				"user-agent":    []string{"grpc-web-js/1.0"},
+				"connection":    []string{"keep-alive"},
+				"x-request-id":  []string{"req-1"},
+			},
+		},
+		{
+			name:           "allow-list wins over a simultaneously set deny-list",
+			forwardHeaders: []string{"x-request-id"},
+			stripHeaders:   []string{"x-request-id"},
+			want:           metadata.MD{"x-request-id": []string{"req-1"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := filterMetadata(md, tc.forwardHeaders, tc.stripHeaders)
+			if len(got) != len(tc.want) {
+				t.Fatalf("filterMetadata() = %v, want %v", got, tc.want)
+			}
+			for key, values := range tc.want {
+				gotValues := got.Get(key)
+				if len(gotValues) != len(values) {
+					t.Errorf("key %q = %v, want %v", key, gotValues, values)
+					continue
+				}
+				for i := range values {
+					if gotValues[i] != values[i] {
+						t.Errorf("key %q[%d] = %q, want %q", key, i, gotValues[i], values[i])
+					}
+				}
+			}
+		})
+	}
+}
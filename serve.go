@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/soheilhy/cmux"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+// runLegacy serves grpc-web and metrics/debug on their own addresses, as
+// before cmux support was added, but now drains cleanly: it waits for ctx to
+// be cancelled (by a caught SIGINT/SIGTERM), then calls GracefulStop/Shutdown
+// on every server and closes the upstream connections within
+// shutdownTimeout before returning.
+func runLegacy(ctx context.Context, cmd *cobra.Command, logger *zap.Logger, srv *grpc.Server, webHandler http.Handler, upstream *upstreamPool, shutdownTimeout time.Duration) error {
+	webClientCATLSConfig, err := NewWebClientCATLSConfig(MustGetString(cmd, "web-client-ca"), MustGetBool(cmd, "web-require-client-cert"))
+	if err != nil {
+		return err
+	}
+
+	certPath := MustGetString(cmd, "web-cert-path")
+	keyPath := MustGetString(cmd, "web-key-path")
+	websrv := &http.Server{
+		Addr:      MustGetString(cmd, "web-addr"),
+		Handler:   webHandler,
+		TLSConfig: webClientCATLSConfig,
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.Handler())
+	registerHealthHandlers(metricsMux, upstream)
+	if MustGetBool(cmd, "enable-pprof") {
+		registerPprofHandlers(metricsMux)
+	}
+	metricssrv := &http.Server{
+		Addr:    MustGetString(cmd, "metrics-addr"),
+		Handler: metricsMux,
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		logger.Info("grpc-web server listening", zap.String("addr", websrv.Addr))
+		var err error
+		if certPath != "" && keyPath != "" {
+			err = websrv.ListenAndServeTLS(certPath, keyPath)
+		} else {
+			err = websrv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		logger.Info("metrics server listening", zap.String("addr", metricssrv.Addr))
+		if err := metricssrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		<-gctx.Done()
+		logger.Info("shutdown signal received, draining")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		gracefulStopServer(srv, shutdownCtx)
+		if err := websrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("grpc-web server did not shut down cleanly", zap.Error(err))
+		}
+		if err := metricssrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("metrics server did not shut down cleanly", zap.Error(err))
+		}
+		if err := upstream.Close(); err != nil {
+			logger.Warn("failed to close upstream connections", zap.Error(err))
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// runMultiplexed serves grpc-web, the metrics/debug endpoints, and
+// (optionally) native grpc clients on a single listen address by sniffing
+// the connection preamble with cmux, mirroring how etcd's grpc-proxy shares
+// one port between gRPC and its HTTP diagnostics. Like runLegacy, it drains
+// in-flight work within shutdownTimeout once ctx is cancelled.
+func runMultiplexed(ctx context.Context, cmd *cobra.Command, logger *zap.Logger, srv *grpc.Server, webHandler http.Handler, upstream *upstreamPool, listenAddr string, shutdownTimeout time.Duration) error {
+	webClientCATLSConfig, err := NewWebClientCATLSConfig(MustGetString(cmd, "web-client-ca"), MustGetBool(cmd, "web-require-client-cert"))
+	if err != nil {
+		return err
+	}
+	webTLSConfig, err := NewWebServerTLSConfig(MustGetString(cmd, "web-cert-path"), MustGetString(cmd, "web-key-path"), webClientCATLSConfig)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	if webTLSConfig != nil {
+		// Terminate TLS (and, via webClientCATLSConfig, client-cert mTLS) on
+		// the raw listener before cmux ever sees a byte, so native grpc and
+		// grpc-web clients get the same TLS termination and address instead
+		// of cleartext-only multiplexing.
+		lis = tls.NewListener(lis, webTLSConfig)
+	}
+
+	m := cmux.New(lis)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	registerHealthHandlers(mux, upstream)
+	if MustGetBool(cmd, "enable-pprof") {
+		registerPprofHandlers(mux)
+	}
+	mux.Handle("/", webHandler)
+	httpsrv := &http.Server{Handler: mux}
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	var grpcL net.Listener
+	if MustGetBool(cmd, "serve-native-grpc") {
+		grpcL = m.Match(cmux.HTTP2HeaderField("content-type", "application/grpc"))
+		g.Go(func() error {
+			logger.Info("native grpc server listening on multiplexed addr", zap.String("addr", listenAddr))
+			if err := srv.Serve(grpcL); err != nil && err != cmux.ErrListenerClosed && err != grpc.ErrServerStopped {
+				return err
+			}
+			return nil
+		})
+	}
+
+	httpL := m.Match(cmux.Any())
+	g.Go(func() error {
+		logger.Info("grpc-web/metrics/debug server listening on multiplexed addr", zap.String("addr", listenAddr))
+		if err := httpsrv.Serve(httpL); err != nil && err != cmux.ErrListenerClosed && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		if err := m.Serve(); err != nil && err != cmux.ErrListenerClosed && !isClosedListenerError(err) {
+			return err
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		<-gctx.Done()
+		logger.Info("shutdown signal received, draining")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		gracefulStopServer(srv, shutdownCtx)
+		if err := httpsrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("grpc-web/metrics/debug server did not shut down cleanly", zap.Error(err))
+		}
+		// Unblocks m.Serve(); cmux has no Close/Shutdown method of its own.
+		if err := lis.Close(); err != nil {
+			logger.Warn("failed to close multiplexed listener", zap.Error(err))
+		}
+		if err := upstream.Close(); err != nil {
+			logger.Warn("failed to close upstream connections", zap.Error(err))
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// gracefulStopServer calls srv.GracefulStop(), falling back to the abrupt
+// srv.Stop() if shutdownCtx expires before in-flight RPCs drain.
+func gracefulStopServer(srv *grpc.Server, shutdownCtx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		srv.Stop()
+	}
+}
+
+// isClosedListenerError reports whether err is the result of Accept()
+// unblocking because lis.Close() was called during shutdown, rather than a
+// real accept failure. m.Serve() wraps the listener's *net.OpError, so this
+// must unwrap and compare against the sentinel instead of matching a
+// hardcoded error string.
+func isClosedListenerError(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
+
+// registerHealthHandlers wires /healthz (liveness) and /readyz (upstream
+// connectivity) onto mux, so orchestrators like Kubernetes can drain the
+// proxy cleanly instead of dropping in-flight streams on process exit.
+func registerHealthHandlers(mux *http.ServeMux, upstream *upstreamPool) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !upstream.Ready() {
+			http.Error(w, "no healthy upstream endpoints", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// registerPprofHandlers wires the standard net/http/pprof debug endpoints
+// onto mux, so they can be exposed alongside metrics instead of only on
+// http.DefaultServeMux.
+func registerPprofHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewUpstreamTLSConfig builds the tls.Config used when dialing the backend.
+// It mirrors etcd grpc-proxy's split between "TLS to backend" and "TLS to
+// listener": the backend may require a client certificate (mTLS) and may be
+// signed by a private CA that isn't in the system trust store, independent
+// of whatever TLS the grpc-web listener presents to browsers.
+//
+// caPath, certPath, keyPath, and serverName are all optional. If none are
+// set, no TLS is configured and the caller should dial insecurely.
+func NewUpstreamTLSConfig(caPath, certPath, keyPath, serverName string) (*tls.Config, error) {
+	if caPath == "" && certPath == "" && keyPath == "" && serverName == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{ServerName: serverName}
+
+	if caPath != "" {
+		pool, err := certPoolFromPEM(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream CA: %v", err)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certPath != "" || keyPath != "" {
+		if certPath == "" || keyPath == "" {
+			return nil, fmt.Errorf("both upstream-cert and upstream-key must be set for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream client cert/key: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// NewWebClientCATLSConfig builds the tls.Config fragment that verifies
+// browser/client certificates against a private CA for mTLS into the
+// grpc-web listener. It returns nil when clientCAPath is empty, i.e. when
+// the listener should only authenticate via its own server certificate.
+func NewWebClientCATLSConfig(clientCAPath string, requireClientCert bool) (*tls.Config, error) {
+	if clientCAPath == "" {
+		if requireClientCert {
+			return nil, fmt.Errorf("web-require-client-cert set without web-client-ca")
+		}
+		return nil, nil
+	}
+
+	pool, err := certPoolFromPEM(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load web client CA: %v", err)
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: clientAuth,
+	}, nil
+}
+
+// NewWebServerTLSConfig loads the grpc-web listener's own server
+// certificate and merges it into clientCATLSConfig (as built by
+// NewWebClientCATLSConfig), so a single tls.Config can both terminate TLS
+// and, if configured, verify browser client certificates. It returns nil,
+// nil when certPath and keyPath are both empty, meaning the caller should
+// serve the listener in cleartext.
+func NewWebServerTLSConfig(certPath, keyPath string, clientCATLSConfig *tls.Config) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("both web-cert-path and web-key-path must be set to terminate TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load web server cert/key: %v", err)
+	}
+
+	cfg := clientCATLSConfig
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg, nil
+}
+
+func certPoolFromPEM(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestNewUpstreamTLSConfig(t *testing.T) {
+	cases := []struct {
+		name           string
+		caPath         string
+		certPath       string
+		keyPath        string
+		serverName     string
+		wantNil        bool
+		wantErr        bool
+		wantServerName string
+	}{
+		{
+			name:    "all empty returns nil config for insecure dial",
+			wantNil: true,
+		},
+		{
+			name:           "server name alone still builds a TLS config",
+			serverName:     "backend.internal",
+			wantServerName: "backend.internal",
+		},
+		{
+			name:     "cert without key is an error",
+			certPath: "testdata/does-not-matter.crt",
+			wantErr:  true,
+		},
+		{
+			name:    "key without cert is an error",
+			keyPath: "testdata/does-not-matter.key",
+			wantErr: true,
+		},
+		{
+			name:    "missing CA file is an error",
+			caPath:  "testdata/does-not-exist.pem",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := NewUpstreamTLSConfig(tc.caPath, tc.certPath, tc.keyPath, tc.serverName)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantNil {
+				if cfg != nil {
+					t.Fatalf("expected nil config, got %+v", cfg)
+				}
+				return
+			}
+			if cfg == nil {
+				t.Fatalf("expected a non-nil config")
+			}
+			if cfg.ServerName != tc.wantServerName {
+				t.Errorf("ServerName = %q, want %q", cfg.ServerName, tc.wantServerName)
+			}
+		})
+	}
+}
+
+func TestNewWebClientCATLSConfig(t *testing.T) {
+	cases := []struct {
+		name              string
+		clientCAPath      string
+		requireClientCert bool
+		wantNil           bool
+		wantErr           bool
+		wantClientAuth    tls.ClientAuthType
+	}{
+		{
+			name:    "no CA path returns nil",
+			wantNil: true,
+		},
+		{
+			name:              "require-client-cert without a CA is an error",
+			requireClientCert: true,
+			wantErr:           true,
+		},
+		{
+			name:         "missing CA file is an error",
+			clientCAPath: "testdata/does-not-exist.pem",
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := NewWebClientCATLSConfig(tc.clientCAPath, tc.requireClientCert)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantNil {
+				if cfg != nil {
+					t.Fatalf("expected nil config, got %+v", cfg)
+				}
+				return
+			}
+			if cfg.ClientAuth != tc.wantClientAuth {
+				t.Errorf("ClientAuth = %v, want %v", cfg.ClientAuth, tc.wantClientAuth)
+			}
+		})
+	}
+}
+
+func TestNewWebServerTLSConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		certPath string
+		keyPath  string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{
+			name:    "no cert or key returns nil for cleartext serving",
+			wantNil: true,
+		},
+		{
+			name:     "cert without key is an error",
+			certPath: "testdata/does-not-matter.crt",
+			wantErr:  true,
+		},
+		{
+			name:    "key without cert is an error",
+			keyPath: "testdata/does-not-matter.key",
+			wantErr: true,
+		},
+		{
+			name:     "unreadable cert/key pair is an error",
+			certPath: "testdata/does-not-exist.crt",
+			keyPath:  "testdata/does-not-exist.key",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := NewWebServerTLSConfig(tc.certPath, tc.keyPath, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantNil && cfg != nil {
+				t.Fatalf("expected nil config, got %+v", cfg)
+			}
+		})
+	}
+}
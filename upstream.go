@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/mwitkow/grpc-proxy/proxy"
+)
+
+// healthCheckInterval is how often each upstream endpoint's health is
+// re-checked via the standard grpc.health.v1 service.
+const healthCheckInterval = 5 * time.Second
+
+// upstreamPool dials a fixed set of upstream endpoints and round-robins RPCs
+// across whichever of them are currently reporting SERVING, mirroring etcd
+// grpc-proxy's fan-out to a set of endpoints instead of a single backend.
+type upstreamPool struct {
+	logger *zap.Logger
+	conns  []*grpc.ClientConn
+
+	mu      sync.RWMutex
+	healthy []bool
+
+	next uint64
+}
+
+// NewUpstreamPool dials addrs (each independently, so one dead endpoint
+// doesn't block the others) and starts a background health-checking loop
+// per endpoint using grpc.health.v1.
+func NewUpstreamPool(logger *zap.Logger, addrs []string, tlsConfig *tls.Config) (*upstreamPool, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("at least one upstream address is required")
+	}
+
+	var opts []grpc.DialOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	opts = append(opts, grpc.WithCodec(proxy.Codec()))
+
+	pool := &upstreamPool{
+		logger:  logger,
+		conns:   make([]*grpc.ClientConn, len(addrs)),
+		healthy: make([]bool, len(addrs)),
+	}
+
+	for i, addr := range addrs {
+		conn, err := grpc.Dial(addr, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial upstream %s: %v", addr, err)
+		}
+		pool.conns[i] = conn
+		// Assume healthy until the first check proves otherwise, so the
+		// proxy can serve traffic immediately instead of failing cold.
+		pool.healthy[i] = true
+		go pool.watchHealth(i, addr, conn)
+	}
+
+	return pool, nil
+}
+
+func (p *upstreamPool) watchHealth(i int, addr string, conn *grpc.ClientConn) {
+	client := healthpb.NewHealthClient(conn)
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckInterval)
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		cancel()
+
+		healthy := err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+
+		p.mu.Lock()
+		wasHealthy := p.healthy[i]
+		p.healthy[i] = healthy
+		p.mu.Unlock()
+
+		if healthy != wasHealthy {
+			if healthy {
+				p.logger.Info("upstream endpoint became healthy", zap.String("addr", addr))
+			} else {
+				p.logger.Warn("upstream endpoint became unhealthy", zap.String("addr", addr), zap.Error(err))
+			}
+		}
+	}
+}
+
+// PickConn round-robins across currently healthy endpoints. It returns
+// codes.Unavailable if none are healthy, rather than silently routing to a
+// dead backend.
+func (p *upstreamPool) PickConn() (*grpc.ClientConn, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	n := uint64(len(p.conns))
+	start := atomic.AddUint64(&p.next, 1)
+	for i := uint64(0); i < n; i++ {
+		idx := (start + i) % n
+		if p.healthy[idx] {
+			return p.conns[idx], nil
+		}
+	}
+
+	return nil, status.Error(codes.Unavailable, "no healthy upstream endpoints")
+}
+
+// Ready reports whether at least one upstream endpoint is currently healthy,
+// for use by a /readyz handler so orchestrators can hold traffic back until
+// a backend is reachable.
+func (p *upstreamPool) Ready() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, healthy := range p.healthy {
+		if healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// Close tears down every dialed connection, returning the first error
+// encountered (if any) after attempting to close them all.
+func (p *upstreamPool) Close() error {
+	var firstErr error
+	for _, conn := range p.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
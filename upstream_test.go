@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func dialTestConns(t *testing.T, n int) []*grpc.ClientConn {
+	t.Helper()
+	conns := make([]*grpc.ClientConn, n)
+	for i := range conns {
+		// WithInsecure and no WithBlock: Dial returns without waiting for a
+		// connection (attempts to 127.0.0.1:0 just fail in the background),
+		// so this is safe to use purely as a distinct *ClientConn identity
+		// for PickConn to hand back.
+		conn, err := grpc.Dial("127.0.0.1:0", grpc.WithInsecure())
+		if err != nil {
+			t.Fatalf("failed to create test conn: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conns[i] = conn
+	}
+	return conns
+}
+
+func TestUpstreamPoolPickConnNoneHealthy(t *testing.T) {
+	conns := dialTestConns(t, 3)
+	pool := &upstreamPool{conns: conns, healthy: []bool{false, false, false}}
+
+	_, err := pool.PickConn()
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("PickConn() err = %v, want codes.Unavailable", err)
+	}
+}
+
+func TestUpstreamPoolPickConnSkipsUnhealthy(t *testing.T) {
+	conns := dialTestConns(t, 3)
+	pool := &upstreamPool{conns: conns, healthy: []bool{false, true, false}}
+
+	for i := 0; i < 5; i++ {
+		conn, err := pool.PickConn()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conn != conns[1] {
+			t.Errorf("PickConn() = %p, want the only healthy conn %p", conn, conns[1])
+		}
+	}
+}
+
+func TestUpstreamPoolPickConnRoundRobinsAcrossHealthy(t *testing.T) {
+	conns := dialTestConns(t, 3)
+	pool := &upstreamPool{conns: conns, healthy: []bool{true, true, true}}
+
+	seen := map[*grpc.ClientConn]bool{}
+	for i := 0; i < len(conns); i++ {
+		conn, err := pool.PickConn()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen[conn] = true
+	}
+
+	if len(seen) != len(conns) {
+		t.Errorf("round-robin over %d calls visited %d distinct conns, want %d", len(conns), len(seen), len(conns))
+	}
+}